@@ -2,16 +2,380 @@ package protocol
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
-	"fmt"
+	"io"
 	"net"
 	"sort"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/gravitational/trace"
 )
 
+var log = logrus.WithField(trace.Component, "db:sqlserver")
+
+// Prelogin option tokens, as defined by the TDS protocol.
+const (
+	preloginVERSION    uint8 = 0x00
+	preloginENCRYPTION uint8 = 0x01
+	preloginINSTOPT    uint8 = 0x02
+	preloginTHREADID   uint8 = 0x03
+	preloginMARS       uint8 = 0x04
+	preloginTERMINATOR uint8 = 0xff
+)
+
+// TDS packet types, as used in the first byte of every packet header.
+const (
+	PacketTypePreLogin uint8 = 0x12
+	// PacketTypeLogin7 is the packet type of the LOGIN7 message sent by
+	// clients once prelogin negotiation completes.
+	PacketTypeLogin7 uint8 = 0x10
+)
+
+// encryptionOption is the wire value of the prelogin ENCRYPTION option, as
+// sent by both client and server.
+type encryptionOption uint8
+
+const (
+	encryptOff    encryptionOption = 0x00
+	encryptOn     encryptionOption = 0x01
+	encryptNotSup encryptionOption = 0x02
+	encryptReq    encryptionOption = 0x03
+)
+
+// EncryptionMode controls how much of a TDS session is protected by TLS once
+// the client and server have negotiated the ENCRYPTION prelogin option.
+type EncryptionMode int
+
+const (
+	// EncryptionModeOff never negotiates encryption; the server always
+	// advertises ENCRYPT_NOT_SUP regardless of what the client requests.
+	EncryptionModeOff EncryptionMode = iota
+	// EncryptionModeLoginOnly encrypts only the LOGIN7 packet, then falls
+	// back to cleartext TDS traffic, matching SQL Server's default
+	// "encrypt login packet only" behavior.
+	EncryptionModeLoginOnly
+	// EncryptionModeFull encrypts the entire TDS session after prelogin
+	// completes.
+	EncryptionModeFull
+)
+
+// PreloginParams configures how HandlePrelogin negotiates TLS with a
+// connecting client.
+type PreloginParams struct {
+	// TLSConfig is used to perform the server side of the TLS handshake
+	// once encryption has been negotiated. If nil, encryption is never
+	// offered to the client.
+	TLSConfig *tls.Config
+	// EncryptionMode selects how much of the session gets encrypted once
+	// the client and server agree to use TLS.
+	EncryptionMode EncryptionMode
+}
+
+// WritePrelogin writes a PRELOGIN response that always advertises
+// ENCRYPT_NOT_SUP. Callers that want to negotiate TLS should use
+// HandlePrelogin instead.
 func WritePrelogin(conn net.Conn) error {
+	return writePreloginPacket(conn, buildPreloginFields(encryptNotSup))
+}
+
+// ReadPrelogin reads and decodes a PRELOGIN packet from conn, returning the
+// raw option values keyed by their token byte (e.g. preloginENCRYPTION).
+func ReadPrelogin(conn net.Conn) (map[uint8][]byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if header[0] != PacketTypePreLogin {
+		return nil, trace.BadParameter("expected PRELOGIN packet type %#x, got %#x", PacketTypePreLogin, header[0])
+	}
+
+	length := binary.BigEndian.Uint16(header[2:4])
+	if length < 8 {
+		return nil, trace.BadParameter("invalid prelogin packet length %d", length)
+	}
+
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	fields := make(map[uint8][]byte)
+	for i := 0; ; {
+		if i+5 > len(body) {
+			return nil, trace.BadParameter("truncated prelogin option list")
+		}
+		token := body[i]
+		if token == preloginTERMINATOR {
+			break
+		}
+		offset := binary.BigEndian.Uint16(body[i+1 : i+3])
+		size := binary.BigEndian.Uint16(body[i+3 : i+5])
+		if int(offset)+int(size) > len(body) {
+			return nil, trace.BadParameter("prelogin option %#x out of bounds", token)
+		}
+		fields[token] = body[offset : offset+size]
+		i += 5
+	}
+
+	return fields, nil
+}
+
+// HandlePrelogin performs the server side of the PRELOGIN handshake,
+// including TLS encryption negotiation, and returns the net.Conn that
+// subsequent TDS messages should be read from and written to. If encryption
+// was negotiated, the returned conn wraps a TLS connection; otherwise the
+// original conn is returned unchanged.
+func HandlePrelogin(conn net.Conn, params PreloginParams) (net.Conn, error) {
+	clientFields, err := ReadPrelogin(conn)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var clientEncryption encryptionOption
+	if v, ok := clientFields[preloginENCRYPTION]; ok && len(v) == 1 {
+		clientEncryption = encryptionOption(v[0])
+	}
+
+	serverEncryption, negotiated := negotiateEncryption(clientEncryption, params)
+	log.Debugf("negotiated prelogin encryption: client=%#x server=%#x tls=%v", clientEncryption, serverEncryption, negotiated)
+
+	if err := writePreloginPacket(conn, buildPreloginFields(serverEncryption)); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	if !negotiated {
+		if clientEncryption == encryptReq {
+			return nil, trace.BadParameter("client requires encryption but none is configured")
+		}
+		return conn, nil
+	}
+
+	// Per MS-TDS 8.1, the TLS handshake records themselves are tunneled
+	// inside PRELOGIN (0x12) TDS packets; only once the handshake
+	// completes do subsequent TDS packets (LOGIN7 and later) travel as
+	// ordinary TLS application data. tdsHandshakeConn strips/adds that
+	// framing for the duration of the handshake only.
+	framedConn := &tdsHandshakeConn{Conn: conn}
+	tlsConn := tls.Server(framedConn, params.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, trace.Wrap(err, "TLS handshake failed")
+	}
+	framedConn.handshakeDone = true
+
+	if params.EncryptionMode == EncryptionModeLoginOnly {
+		return newLoginOnlyConn(tlsConn, conn), nil
+	}
+
+	return tlsConn, nil
+}
+
+// negotiateEncryption decides the server's ENCRYPTION response given the
+// client's requested value and the locally configured policy. The second
+// return value reports whether the session should continue over TLS.
+//
+// Per MS-TDS, ENCRYPT_OFF means "only the login packet is encrypted" and
+// ENCRYPT_ON means "the entire session is encrypted" - so the response for
+// an OFF/ON request depends on whether the server is configured for
+// EncryptionModeLoginOnly or EncryptionModeFull.
+func negotiateEncryption(client encryptionOption, params PreloginParams) (encryptionOption, bool) {
+	if params.TLSConfig == nil || params.EncryptionMode == EncryptionModeOff {
+		return encryptNotSup, false
+	}
+
+	switch client {
+	case encryptNotSup:
+		return encryptNotSup, false
+	case encryptReq:
+		if params.EncryptionMode != EncryptionModeFull {
+			// The client requires the whole session to be encrypted, but
+			// the server is only configured to encrypt the login packet;
+			// there's no way to satisfy that, so decline.
+			return encryptNotSup, false
+		}
+		return encryptReq, true
+	default: // encryptOff or encryptOn
+		if params.EncryptionMode == EncryptionModeLoginOnly {
+			return encryptOff, true
+		}
+		return encryptOn, true
+	}
+}
+
+// tdsHandshakeConn wraps a net.Conn so that bytes written/read during a TLS
+// handshake are framed as PRELOGIN (0x12) TDS packets, as MS-TDS requires
+// during encryption negotiation. Once handshakeDone is set, it passes
+// Read/Write straight through, since post-handshake traffic is raw TLS
+// application data with no further PRELOGIN framing.
+type tdsHandshakeConn struct {
+	net.Conn
+	handshakeDone bool
+	readBuf       bytes.Buffer
+}
+
+// tdsHandshakeChunkSize bounds how much handshake data is packed into a
+// single outgoing TDS packet.
+const tdsHandshakeChunkSize = 4096 - 8
+
+func (c *tdsHandshakeConn) Read(b []byte) (int, error) {
+	if c.handshakeDone {
+		return c.Conn.Read(b)
+	}
+
+	if c.readBuf.Len() == 0 {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(c.Conn, header); err != nil {
+			return 0, err
+		}
+		if header[0] != PacketTypePreLogin {
+			return 0, trace.BadParameter("unexpected TDS packet type %#x during TLS handshake", header[0])
+		}
+
+		length := binary.BigEndian.Uint16(header[2:4])
+		if length < 8 {
+			return 0, trace.BadParameter("invalid TDS packet length %d during TLS handshake", length)
+		}
+
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(c.Conn, body); err != nil {
+			return 0, err
+		}
+		c.readBuf.Write(body)
+	}
+
+	return c.readBuf.Read(b)
+}
+
+func (c *tdsHandshakeConn) Write(b []byte) (int, error) {
+	if c.handshakeDone {
+		return c.Conn.Write(b)
+	}
+
+	total := len(b)
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > tdsHandshakeChunkSize {
+			chunk = chunk[:tdsHandshakeChunkSize]
+		}
+
+		header := []byte{PacketTypePreLogin, 0x1, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint16(header[2:4], uint16(len(header)+len(chunk)))
+
+		if _, err := c.Conn.Write(header); err != nil {
+			return 0, err
+		}
+		if _, err := c.Conn.Write(chunk); err != nil {
+			return 0, err
+		}
+
+		b = b[len(chunk):]
+	}
+
+	return total, nil
+}
+
+// loginOnlyConn wraps a TLS connection but only uses it to read the
+// client's LOGIN7 packet, transparently falling back to the underlying
+// cleartext connection for all reads after that packet completes. Writes,
+// including the server's response to LOGIN7, always use the cleartext
+// connection.
+//
+// Packet boundaries are tracked explicitly via tdsPacketScanner rather than
+// inspecting the first byte of whatever a single Read call happens to
+// return, since crypto/tls may deliver a TDS packet in several fragments.
+type loginOnlyConn struct {
+	net.Conn // cleartext connection, used once LOGIN7 has been read
+	tls      *tls.Conn
+
+	readDone bool
+
+	readScanner tdsPacketScanner
+}
+
+func newLoginOnlyConn(tlsConn *tls.Conn, raw net.Conn) *loginOnlyConn {
+	return &loginOnlyConn{Conn: raw, tls: tlsConn}
+}
+
+func (c *loginOnlyConn) Read(b []byte) (int, error) {
+	if c.readDone {
+		return c.Conn.Read(b)
+	}
+
+	n, err := c.tls.Read(b)
+	if n > 0 {
+		c.readScanner.consume(b[:n], func(pktType uint8, eom bool) {
+			if pktType == PacketTypeLogin7 && eom {
+				c.readDone = true
+			}
+		})
+	}
+	return n, err
+}
+
+// Write always uses the cleartext connection: the server only writes once
+// LOGIN7 has been read, and only the LOGIN7 packet itself is encrypted.
+func (c *loginOnlyConn) Write(b []byte) (int, error) {
+	return c.Conn.Write(b)
+}
+
+// tdsPacketScanner tracks progress through a stream of TDS packets across
+// multiple Read/Write calls, reporting the type and EOM (end-of-message)
+// status of each packet as it completes.
+type tdsPacketScanner struct {
+	header    [8]byte
+	headerLen int
+	bodyLen   int
+	bodyRead  int
+}
+
+// consume processes freshly read/written bytes, invoking onPacket once for
+// every TDS packet that completes within b.
+func (s *tdsPacketScanner) consume(b []byte, onPacket func(pktType uint8, eom bool)) {
+	for len(b) > 0 {
+		if s.headerLen < len(s.header) {
+			n := copy(s.header[s.headerLen:], b)
+			s.headerLen += n
+			b = b[n:]
+			if s.headerLen < len(s.header) {
+				return
+			}
+
+			length := int(binary.BigEndian.Uint16(s.header[2:4]))
+			s.bodyLen = length - len(s.header)
+			if s.bodyLen < 0 {
+				s.bodyLen = 0
+			}
+			s.bodyRead = 0
+		}
+
+		remaining := s.bodyLen - s.bodyRead
+		n := remaining
+		if n > len(b) {
+			n = len(b)
+		}
+		s.bodyRead += n
+		b = b[n:]
+
+		if s.bodyRead >= s.bodyLen {
+			onPacket(s.header[0], s.header[1]&0x01 != 0)
+			s.headerLen = 0
+		}
+	}
+}
+
+func buildPreloginFields(encryption encryptionOption) map[uint8][]byte {
+	return map[uint8][]byte{
+		preloginVERSION:    {0, 0, 0, 0, 0, 0},
+		preloginENCRYPTION: {byte(encryption)},
+		preloginINSTOPT:    append([]byte("teleport"), 0), // 0-terminated instance name
+		preloginTHREADID:   {0, 0, 0, 0},
+		preloginMARS:       {0}, // MARS disabled
+	}
+}
+
+func writePreloginPacket(conn net.Conn, fields map[uint8][]byte) error {
 	var err error
 
 	w := bytes.NewBuffer([]byte{
@@ -23,14 +387,6 @@ func WritePrelogin(conn net.Conn) error {
 		0,
 	})
 
-	fields := map[uint8][]byte{
-		preloginVERSION:    {0, 0, 0, 0, 0, 0},
-		preloginENCRYPTION: {encryptNotSup},
-		preloginINSTOPT:    append([]byte("teleport"), 0), // 0-terminated instance name
-		preloginTHREADID:   {0, 0, 0, 0},
-		preloginMARS:       {0}, // MARS disabled
-	}
-
 	offset := uint16(5*len(fields) + 1)
 	keys := make(keySlice, 0, len(fields))
 	for k := range fields {
@@ -78,7 +434,7 @@ func WritePrelogin(conn net.Conn) error {
 	pktBytes := w.Bytes()
 	binary.BigEndian.PutUint16(pktBytes[2:], uint16(len(pktBytes)))
 
-	fmt.Printf("Writing prelogin response: %v\n", pktBytes)
+	log.Debugf("writing prelogin response: %v", pktBytes)
 
 	// Write packet to connection.
 	_, err = conn.Write(pktBytes)
@@ -0,0 +1,126 @@
+package protocol
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestPreloginRoundTrip(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- WritePrelogin(server)
+	}()
+
+	fields, err := ReadPrelogin(client)
+	if err != nil {
+		t.Fatalf("ReadPrelogin failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("WritePrelogin failed: %v", err)
+	}
+
+	encryption, ok := fields[preloginENCRYPTION]
+	if !ok || len(encryption) != 1 || encryptionOption(encryption[0]) != encryptNotSup {
+		t.Errorf("unexpected ENCRYPTION field: %v", encryption)
+	}
+
+	instOpt, ok := fields[preloginINSTOPT]
+	if !ok || string(instOpt) != "teleport\x00" {
+		t.Errorf("unexpected INSTOPT field: %q", instOpt)
+	}
+
+	if _, ok := fields[preloginVERSION]; !ok {
+		t.Errorf("expected VERSION field to be present")
+	}
+}
+
+func TestNegotiateEncryption(t *testing.T) {
+	tlsConfig := &tls.Config{}
+
+	tests := []struct {
+		name           string
+		client         encryptionOption
+		params         PreloginParams
+		wantServer     encryptionOption
+		wantNegotiated bool
+	}{
+		{
+			name:           "no tls config configured",
+			client:         encryptOn,
+			params:         PreloginParams{EncryptionMode: EncryptionModeFull},
+			wantServer:     encryptNotSup,
+			wantNegotiated: false,
+		},
+		{
+			name:           "encryption mode off",
+			client:         encryptOn,
+			params:         PreloginParams{TLSConfig: tlsConfig, EncryptionMode: EncryptionModeOff},
+			wantServer:     encryptNotSup,
+			wantNegotiated: false,
+		},
+		{
+			name:           "client not supported",
+			client:         encryptNotSup,
+			params:         PreloginParams{TLSConfig: tlsConfig, EncryptionMode: EncryptionModeFull},
+			wantServer:     encryptNotSup,
+			wantNegotiated: false,
+		},
+		{
+			name:           "full mode, client off",
+			client:         encryptOff,
+			params:         PreloginParams{TLSConfig: tlsConfig, EncryptionMode: EncryptionModeFull},
+			wantServer:     encryptOn,
+			wantNegotiated: true,
+		},
+		{
+			name:           "full mode, client on",
+			client:         encryptOn,
+			params:         PreloginParams{TLSConfig: tlsConfig, EncryptionMode: EncryptionModeFull},
+			wantServer:     encryptOn,
+			wantNegotiated: true,
+		},
+		{
+			name:           "full mode, client req",
+			client:         encryptReq,
+			params:         PreloginParams{TLSConfig: tlsConfig, EncryptionMode: EncryptionModeFull},
+			wantServer:     encryptReq,
+			wantNegotiated: true,
+		},
+		{
+			name:           "login-only mode, client off",
+			client:         encryptOff,
+			params:         PreloginParams{TLSConfig: tlsConfig, EncryptionMode: EncryptionModeLoginOnly},
+			wantServer:     encryptOff,
+			wantNegotiated: true,
+		},
+		{
+			name:           "login-only mode, client on",
+			client:         encryptOn,
+			params:         PreloginParams{TLSConfig: tlsConfig, EncryptionMode: EncryptionModeLoginOnly},
+			wantServer:     encryptOff,
+			wantNegotiated: true,
+		},
+		{
+			name:           "login-only mode, client req is unsatisfiable",
+			client:         encryptReq,
+			params:         PreloginParams{TLSConfig: tlsConfig, EncryptionMode: EncryptionModeLoginOnly},
+			wantServer:     encryptNotSup,
+			wantNegotiated: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotServer, gotNegotiated := negotiateEncryption(tt.client, tt.params)
+			if gotServer != tt.wantServer || gotNegotiated != tt.wantNegotiated {
+				t.Errorf("negotiateEncryption(%v, %+v) = (%v, %v), want (%v, %v)",
+					tt.client, tt.params, gotServer, gotNegotiated, tt.wantServer, tt.wantNegotiated)
+			}
+		})
+	}
+}
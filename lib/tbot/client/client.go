@@ -0,0 +1,125 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package client provides a minimal client for consuming bot credentials
+// streamed over a `unix` destination socket, as an alternative to reading
+// renewed certificates from disk.
+package client
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+
+	"github.com/gravitational/trace"
+)
+
+// Identity is a single renewed set of bot credentials, as streamed by a
+// `unix` destination.
+type Identity struct {
+	// Cert is the client's current certificate, PEM encoded.
+	Cert []byte `json:"cert"`
+	// Key is the certificate's private key, PEM encoded.
+	Key []byte `json:"key"`
+	// CACerts contains the trusted certificate authorities needed to
+	// validate the Teleport cluster.
+	CACerts [][]byte `json:"ca_certs"`
+}
+
+// Artifact names understood by DestinationUnix.Write
+// (tool/tbot/config/destination_unix.go) when assembling an Identity to
+// stream. The two sides must stay in sync; reference these constants
+// rather than the raw strings so the contract lives in one place.
+const (
+	ArtifactCert     = "tlscert"
+	ArtifactKey      = "key"
+	ArtifactCACert   = "ca.pem"
+	ArtifactIdentity = "identity"
+)
+
+// maxPacketSize bounds a single read on a SOCK_SEQPACKET connection, where
+// an Identity bundle arrives as exactly one datagram per Write.
+const maxPacketSize = 1 << 20 // 1 MiB
+
+// Client streams Identity updates from a tbot `unix` destination socket.
+type Client struct {
+	conn    net.Conn
+	network string
+}
+
+// Dial connects to a `unix` destination socket at path. network should be
+// "unix" or "unixpacket", matching how the destination was configured. If
+// tlsConfig is non-nil, the connection is wrapped in TLS.
+func Dial(network, path string, tlsConfig *tls.Config) (*Client, error) {
+	if network == "" {
+		network = "unix"
+	}
+
+	conn, err := net.Dial(network, path)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	if tlsConfig != nil {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	return &Client{conn: conn, network: network}, nil
+}
+
+// Next blocks until the next Identity is streamed by the destination, or
+// returns an error if the connection is closed.
+//
+// Framing depends on the socket type: on "unixpacket" each Write on the
+// server side is exactly one datagram, so a single Read yields the whole
+// message with no length prefix. On "unix" (a byte stream) writes can be
+// split or coalesced by the kernel, so messages are length-prefixed and
+// reassembled with ReadFull.
+func (c *Client) Next() (*Identity, error) {
+	var payload []byte
+	if c.network == "unixpacket" {
+		buf := make([]byte, maxPacketSize)
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		payload = buf[:n]
+	} else {
+		var length uint32
+		if err := binary.Read(c.conn, binary.BigEndian, &length); err != nil {
+			return nil, trace.Wrap(err)
+		}
+
+		payload = make([]byte, length)
+		if _, err := io.ReadFull(c.conn, payload); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+
+	var ident Identity
+	if err := json.Unmarshal(payload, &ident); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return &ident, nil
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
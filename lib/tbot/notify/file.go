@@ -0,0 +1,50 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/gravitational/trace"
+)
+
+// File notifies by appending a JSONL record per event to a local file. It
+// is primarily intended for testing and for operators who want to tail
+// renewal history without standing up a webhook receiver.
+type File struct {
+	// Path is the file to append events to. It is created if it doesn't
+	// already exist.
+	Path string
+}
+
+func (f *File) Notify(_ context.Context, event Event) error {
+	fh, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer fh.Close()
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	_, err = fh.Write(append(line, '\n'))
+	return trace.Wrap(err)
+}
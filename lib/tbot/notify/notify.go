@@ -0,0 +1,142 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify implements notifiers that alert operators about tbot
+// renewal events: failures, recoveries, and approaching certificate
+// expiry.
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gravitational/teleport"
+	"github.com/gravitational/trace"
+)
+
+var log = logrus.WithFields(logrus.Fields{
+	trace.Component: teleport.ComponentTBot,
+})
+
+// EventType identifies the kind of renewal event being reported.
+type EventType string
+
+const (
+	// EventFailure is sent when a renewal attempt fails.
+	EventFailure EventType = "failure"
+	// EventRecovery is sent when a renewal succeeds after a prior failure.
+	EventRecovery EventType = "recovery"
+	// EventExpiryWarning is sent when the remaining certificate lifetime
+	// crosses a configured threshold.
+	EventExpiryWarning EventType = "expiry_warning"
+)
+
+// Event describes a single renewal event to be reported to notifiers.
+type Event struct {
+	// Type is the kind of event being reported.
+	Type EventType
+	// Message is a human-readable summary of the event.
+	Message string
+	// Err is the error that caused the event, if any.
+	Err error
+	// Time is when the event occurred.
+	Time time.Time
+}
+
+// Notifier delivers renewal events to some external system, such as a
+// webhook or an email inbox.
+type Notifier interface {
+	// Notify delivers event, returning an error if delivery failed.
+	Notify(ctx context.Context, event Event) error
+}
+
+// Dispatcher fans a renewal event out to a set of notifiers, honoring each
+// notifier's event filter and minimum interval between sends.
+type Dispatcher struct {
+	entries []*dispatchEntry
+}
+
+type dispatchEntry struct {
+	notifier    Notifier
+	on          map[EventType]bool
+	minInterval time.Duration
+
+	mu       sync.Mutex
+	lastSent map[EventType]time.Time
+}
+
+// NewDispatcher returns an empty Dispatcher.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Add registers a notifier with the dispatcher. If on is non-empty, the
+// notifier only receives events of those types. If minInterval is nonzero,
+// repeated events of the same type are suppressed until it has elapsed.
+func (d *Dispatcher) Add(notifier Notifier, on []EventType, minInterval time.Duration) {
+	filter := make(map[EventType]bool, len(on))
+	for _, t := range on {
+		filter[t] = true
+	}
+
+	d.entries = append(d.entries, &dispatchEntry{
+		notifier:    notifier,
+		on:          filter,
+		minInterval: minInterval,
+		lastSent:    make(map[EventType]time.Time),
+	})
+}
+
+// Dispatch delivers event to every registered notifier whose filter and
+// flood-suppression interval allow it. Notifier errors are logged, not
+// returned, so that one failing notifier doesn't prevent the others from
+// being reached. Dispatch may be called concurrently.
+func (d *Dispatcher) Dispatch(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	for _, e := range d.entries {
+		if len(e.on) > 0 && !e.on[event.Type] {
+			continue
+		}
+
+		if !e.shouldSend(event) {
+			continue
+		}
+
+		if err := e.notifier.Notify(ctx, event); err != nil {
+			log.WithError(err).Warn("failed to deliver renewal notification")
+		}
+	}
+}
+
+// shouldSend reports whether event is outside e's flood-suppression
+// interval for its type, recording it as sent if so.
+func (e *dispatchEntry) shouldSend(event Event) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if last, ok := e.lastSent[event.Type]; ok && e.minInterval > 0 && event.Time.Sub(last) < e.minInterval {
+		return false
+	}
+	e.lastSent[event.Type] = event.Time
+
+	return true
+}
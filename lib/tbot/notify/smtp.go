@@ -0,0 +1,48 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+
+	"github.com/gravitational/trace"
+)
+
+// SMTP notifies by sending a plain-text email summarizing the event.
+type SMTP struct {
+	// Addr is the SMTP server address, as host:port.
+	Addr string
+	// From is the sender address.
+	From string
+	// To is the list of recipient addresses.
+	To []string
+	// Auth, if set, authenticates with the SMTP server before sending.
+	Auth smtp.Auth
+}
+
+func (s *SMTP) Notify(_ context.Context, event Event) error {
+	body := event.Message
+	if event.Err != nil {
+		body = fmt.Sprintf("%s\n\n%s", body, event.Err)
+	}
+
+	msg := fmt.Sprintf("Subject: tbot renewal %s\r\n\r\n%s\r\n", event.Type, body)
+
+	return trace.Wrap(smtp.SendMail(s.Addr, s.Auth, s.From, s.To, []byte(msg)))
+}
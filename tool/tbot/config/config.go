@@ -21,6 +21,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -28,6 +29,7 @@ import (
 
 	"github.com/gravitational/teleport"
 	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/lib/tbot/notify"
 	"github.com/gravitational/trace"
 )
 
@@ -37,6 +39,14 @@ const (
 	DefaultJoinMethod     = "token"
 )
 
+// Cloud workload-identity join methods, in addition to the "token" and
+// "iam" methods already supported by types.JoinMethod.
+const (
+	JoinMethodGCP        types.JoinMethod = "gcp"
+	JoinMethodAzure      types.JoinMethod = "azure"
+	JoinMethodExecutable types.JoinMethod = "executable"
+)
+
 var log = logrus.WithFields(logrus.Fields{
 	trace.Component: teleport.ComponentTBot,
 })
@@ -73,6 +83,24 @@ type CLIConf struct {
 	// initial certificate
 	JoinMethod string
 
+	// GCPAudience is the audience value to request when fetching a GCP
+	// identity token, used with --join-method=gcp.
+	GCPAudience string
+
+	// GCPServiceAccountEmail impersonates a GCP service account when
+	// fetching a GCP identity token, used with --join-method=gcp.
+	GCPServiceAccountEmail string
+
+	// AllowExecutable allows the executable join method to run a
+	// configured command to produce a join token. It must be explicitly
+	// enabled since it allows a config file to drive code execution.
+	AllowExecutable bool
+
+	// NotifyWebhook is a convenience for configuring a single webhook
+	// notifier from the CLI, equivalent to a notifiers entry with
+	// `on: [failure, recovery, expiry_warning]`.
+	NotifyWebhook string
+
 	// Oneshot controls whether the bot quits after a single renewal.
 	Oneshot bool
 
@@ -112,6 +140,69 @@ type OnboardingConfig struct {
 	// JoinMethod is the method the bot should use to exchange a token for the
 	// initial certificate
 	JoinMethod types.JoinMethod `yaml:"join_method"`
+
+	// GCP configures the `gcp` join method, which exchanges a GCP identity
+	// token for a bot certificate. Required when JoinMethod is "gcp".
+	GCP *GCPOnboardingConfig `yaml:"gcp,omitempty"`
+
+	// Azure configures the `azure` join method, which exchanges an Azure
+	// attested data document for a bot certificate. Required when
+	// JoinMethod is "azure".
+	Azure *AzureOnboardingConfig `yaml:"azure,omitempty"`
+
+	// Executable configures the `executable` join method, which runs a
+	// configured command to produce a subject token. Required when
+	// JoinMethod is "executable".
+	Executable *ExecutableOnboardingConfig `yaml:"executable,omitempty"`
+
+	// AllowExecutable must be explicitly set to use the `executable` join
+	// method, since it allows a config file to drive code execution.
+	AllowExecutable bool `yaml:"allow_executable,omitempty"`
+}
+
+// CheckAndSetDefaults validates the onboarding config, including whichever
+// cloud credential source is required by JoinMethod.
+func (conf *OnboardingConfig) CheckAndSetDefaults() error {
+	switch conf.JoinMethod {
+	case JoinMethodGCP:
+		if conf.GCP == nil {
+			return trace.BadParameter("join_method %q requires a gcp config block", conf.JoinMethod)
+		}
+		return trace.Wrap(conf.GCP.CheckAndSetDefaults())
+	case JoinMethodAzure:
+		if conf.Azure == nil {
+			return trace.BadParameter("join_method %q requires an azure config block", conf.JoinMethod)
+		}
+		return trace.Wrap(conf.Azure.CheckAndSetDefaults())
+	case JoinMethodExecutable:
+		if !conf.AllowExecutable {
+			return trace.BadParameter("join_method %q requires allow_executable: true", conf.JoinMethod)
+		}
+		if conf.Executable == nil {
+			return trace.BadParameter("join_method %q requires an executable config block", conf.JoinMethod)
+		}
+		return trace.Wrap(conf.Executable.CheckAndSetDefaults())
+	}
+
+	return nil
+}
+
+// CredentialSource returns the CredentialSource implied by JoinMethod, or
+// nil if JoinMethod does not use one (e.g. the static "token" method).
+func (conf *OnboardingConfig) CredentialSource() (CredentialSource, error) {
+	switch conf.JoinMethod {
+	case JoinMethodGCP:
+		return conf.GCP, nil
+	case JoinMethodAzure:
+		return conf.Azure, nil
+	case JoinMethodExecutable:
+		if !conf.AllowExecutable {
+			return nil, trace.BadParameter("join_method %q requires allow_executable: true", conf.JoinMethod)
+		}
+		return conf.Executable, nil
+	default:
+		return nil, nil
+	}
 }
 
 // BotConfig is the bot's root config object.
@@ -119,15 +210,29 @@ type BotConfig struct {
 	Onboarding   *OnboardingConfig    `yaml:"onboarding,omitempty"`
 	Storage      *StorageConfig       `yaml:"storage,omitempty"`
 	Destinations []*DestinationConfig `yaml:"destinations,omitempty"`
+	Notifiers    []*NotifierConfig    `yaml:"notifiers,omitempty"`
+
+	RemoteConfig *RemoteConfig `yaml:"remote_config,omitempty"`
 
 	Debug           bool          `yaml:"debug"`
 	AuthServer      string        `yaml:"auth_server"`
 	CertificateTTL  time.Duration `yaml:"certificate_ttl"`
 	RenewalInterval time.Duration `yaml:"renewal_interval"`
 	Oneshot         bool          `yaml:"oneshot"`
+
+	// remoteMu guards remoteDestinations, which is populated by
+	// StartRemoteConfigWatcher and read by EffectiveDestinations.
+	remoteMu           sync.RWMutex
+	remoteDestinations []*DestinationConfig
 }
 
 func (conf *BotConfig) CheckAndSetDefaults() error {
+	if conf.Onboarding != nil {
+		if err := conf.Onboarding.CheckAndSetDefaults(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
 	if conf.Storage == nil {
 		conf.Storage = &StorageConfig{}
 	}
@@ -142,6 +247,18 @@ func (conf *BotConfig) CheckAndSetDefaults() error {
 		}
 	}
 
+	for _, notifier := range conf.Notifiers {
+		if err := notifier.CheckAndSetDefaults(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
+	if conf.RemoteConfig != nil {
+		if err := conf.RemoteConfig.CheckAndSetDefaults(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
 	if conf.CertificateTTL == 0 {
 		conf.CertificateTTL = DefaultCertificateTTL
 	}
@@ -153,25 +270,16 @@ func (conf *BotConfig) CheckAndSetDefaults() error {
 	return nil
 }
 
-// GetDestinationByPath attempts to fetch a destination by its filesystem path.
-// Only valid for filesystem destinations; returns nil if no matching
-// destination exists.
+// GetDestinationByPath attempts to fetch a destination by its filesystem
+// path. Valid for filesystem and Unix socket destinations; returns nil if no
+// matching destination exists.
 func (conf *BotConfig) GetDestinationByPath(path string) (*DestinationConfig, error) {
 	for _, dest := range conf.Destinations {
-		destImpl, err := dest.GetDestination()
-		if err != nil {
-			return nil, trace.Wrap(err)
-		}
-
-		destDir, ok := destImpl.(*DestinationDirectory)
-		if !ok {
-			continue
-		}
-
 		// Note: this compares only paths as written in the config file. We
 		// might want to compare .Abs() if that proves to be confusing (though
 		// this may have its own problems)
-		if destDir.Path == path {
+		destPath, ok := destinationPath(dest)
+		if ok && destPath == path {
 			return dest, nil
 		}
 	}
@@ -179,6 +287,22 @@ func (conf *BotConfig) GetDestinationByPath(path string) (*DestinationConfig, er
 	return nil, nil
 }
 
+// NewNotifyDispatcher builds a notify.Dispatcher from conf.Notifiers, for
+// the renewal loop to call after each renewal attempt.
+func (conf *BotConfig) NewNotifyDispatcher() (*notify.Dispatcher, error) {
+	dispatcher := notify.NewDispatcher()
+
+	for _, nc := range conf.Notifiers {
+		notifier, err := nc.GetNotifier()
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		dispatcher.Add(notifier, nc.EventTypes(), nc.MinInterval)
+	}
+
+	return dispatcher, nil
+}
+
 // NewDefaultConfig creates a new minimal bot configuration from defaults.
 // CheckAndSetDefaults() will be called.
 func NewDefaultConfig(authServer string) (*BotConfig, error) {
@@ -277,7 +401,7 @@ func FromCLIConf(cf *CLIConf) (*BotConfig, error) {
 	// (CAPath, CAPins, etc follow different codepaths so we don't want a
 	// situation where different fields become set weirdly due to struct
 	// merging)
-	if cf.Token != "" || len(cf.CAPins) > 0 || cf.JoinMethod != "" {
+	if cf.Token != "" || len(cf.CAPins) > 0 || cf.JoinMethod != "" || cf.GCPAudience != "" {
 		onboarding := config.Onboarding
 		if onboarding != nil && (onboarding.Token != "" || onboarding.CAPath != "" || len(onboarding.CAPins) > 0) || cf.JoinMethod != DefaultJoinMethod {
 			// To be safe, warn about possible confusion.
@@ -285,10 +409,29 @@ func FromCLIConf(cf *CLIConf) (*BotConfig, error) {
 		}
 
 		config.Onboarding = &OnboardingConfig{
-			Token:      cf.Token,
-			CAPins:     cf.CAPins,
-			JoinMethod: types.JoinMethod(cf.JoinMethod),
+			Token:           cf.Token,
+			CAPins:          cf.CAPins,
+			JoinMethod:      types.JoinMethod(cf.JoinMethod),
+			AllowExecutable: cf.AllowExecutable,
 		}
+
+		if cf.GCPAudience != "" || cf.GCPServiceAccountEmail != "" {
+			config.Onboarding.GCP = &GCPOnboardingConfig{
+				Audience:            cf.GCPAudience,
+				ServiceAccountEmail: cf.GCPServiceAccountEmail,
+			}
+		}
+	}
+
+	if cf.NotifyWebhook != "" {
+		if len(config.Notifiers) > 0 {
+			log.Warnf("CLI parameters are overriding notifiers configured in %s", cf.ConfigPath)
+		}
+
+		config.Notifiers = []*NotifierConfig{{
+			Webhook: &WebhookNotifierConfig{URL: cf.NotifyWebhook},
+			On:      []string{string(notify.EventFailure), string(notify.EventRecovery), string(notify.EventExpiryWarning)},
+		}}
 	}
 
 	if err := config.CheckAndSetDefaults(); err != nil {
@@ -0,0 +1,178 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gravitational/trace"
+)
+
+// DefaultStoragePath is where the bot's internal certificates are written
+// if no storage destination is configured.
+const DefaultStoragePath = "/var/lib/teleport/bot"
+
+// Destination can be implemented by any source/sink of renewable
+// certificates, such as a directory on disk or a Unix socket.
+type Destination interface {
+	// CheckAndSetDefaults validates and sets default values for the
+	// destination's own configuration.
+	CheckAndSetDefaults() error
+
+	// Init prepares the destination to receive writes, e.g. creating
+	// directories or listening sockets.
+	Init() error
+
+	// Verify confirms that the destination is ready to be written to.
+	Verify() error
+
+	// Write stores a named piece of data (e.g. "identity" or "tlscert") at
+	// the destination.
+	Write(name string, data []byte) error
+
+	// Read fetches a named piece of data from the destination.
+	Read(name string) ([]byte, error)
+
+	// String returns a human-readable description of the destination, for
+	// use in logs.
+	String() string
+}
+
+// DestinationMixin can be embedded in a struct to allow various kinds of
+// destinations to be deserialized from a single YAML key, since yaml.v3 has
+// no concept of polymorphism.
+type DestinationMixin struct {
+	Directory *DestinationDirectory `yaml:"directory,omitempty"`
+	Unix      *DestinationUnix      `yaml:"unix,omitempty"`
+}
+
+// GetDestination returns the configured destination implementation, or an
+// error if none (or more than one) is configured.
+func (dm *DestinationMixin) GetDestination() (Destination, error) {
+	count := 0
+	var dest Destination
+
+	if dm.Directory != nil {
+		count++
+		dest = dm.Directory
+	}
+
+	if dm.Unix != nil {
+		count++
+		dest = dm.Unix
+	}
+
+	if count == 0 {
+		return nil, trace.BadParameter("no destination configured")
+	}
+	if count > 1 {
+		return nil, trace.BadParameter("multiple destinations configured, expected only one")
+	}
+
+	return dest, nil
+}
+
+// CheckAndSetDefaults validates and sets defaults for whichever destination
+// kind is configured.
+func (dm *DestinationMixin) CheckAndSetDefaults() error {
+	dest, err := dm.GetDestination()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	return trace.Wrap(dest.CheckAndSetDefaults())
+}
+
+// DestinationConfig configures a user-facing destination: a named set of
+// roles and artifacts written to some Destination.
+type DestinationConfig struct {
+	DestinationMixin `yaml:",inline"`
+
+	// Roles is the list of roles to include in certificates written to
+	// this destination. If empty, all of the bot's roles are included.
+	Roles []string `yaml:"roles,omitempty"`
+}
+
+// CheckAndSetDefaults validates and sets defaults for the destination
+// config, delegating to whichever destination kind is configured.
+func (dc *DestinationConfig) CheckAndSetDefaults() error {
+	return trace.Wrap(dc.DestinationMixin.CheckAndSetDefaults())
+}
+
+// StorageConfig contains config parameters for the bot's internal
+// certificate storage, which (unlike user-facing destinations) always uses
+// a single destination.
+type StorageConfig struct {
+	DestinationMixin `yaml:",inline"`
+}
+
+// CheckAndSetDefaults validates and sets defaults for the storage config. If
+// no destination was configured, a default on-disk directory is used.
+func (sc *StorageConfig) CheckAndSetDefaults() error {
+	if sc.Directory == nil && sc.Unix == nil {
+		sc.Directory = &DestinationDirectory{Path: DefaultStoragePath}
+	}
+
+	// The bot reads its own identity back from storage on every renewal, but
+	// DestinationUnix is a write-only stream with no backing store, so it
+	// can never satisfy that read. Reject it here rather than let it fail
+	// at the first renewal.
+	if sc.Unix != nil {
+		return trace.BadParameter("a unix destination cannot be used for bot storage, as it does not support reading data back")
+	}
+
+	return trace.Wrap(sc.DestinationMixin.CheckAndSetDefaults())
+}
+
+// DestinationDirectory writes bot artifacts to a directory on disk.
+type DestinationDirectory struct {
+	// Path is the directory to write to. It will be created if it does not
+	// already exist.
+	Path string `yaml:"path,omitempty"`
+}
+
+func (dd *DestinationDirectory) CheckAndSetDefaults() error {
+	if dd.Path == "" {
+		return trace.BadParameter("destination directory path must not be empty")
+	}
+
+	return nil
+}
+
+func (dd *DestinationDirectory) Init() error {
+	return trace.Wrap(os.MkdirAll(dd.Path, 0700))
+}
+
+func (dd *DestinationDirectory) Verify() error {
+	_, err := os.Stat(dd.Path)
+	return trace.Wrap(err)
+}
+
+func (dd *DestinationDirectory) Write(name string, data []byte) error {
+	return trace.Wrap(os.WriteFile(filepath.Join(dd.Path, name), data, 0600))
+}
+
+func (dd *DestinationDirectory) Read(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dd.Path, name))
+	return data, trace.Wrap(err)
+}
+
+func (dd *DestinationDirectory) String() string {
+	return fmt.Sprintf("directory %s", dd.Path)
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/tbot/client"
+)
+
+// DestinationUnixTLSConfig configures optional TLS on a DestinationUnix
+// socket, for cases where the socket is reachable outside of the bot's own
+// pod/namespace.
+type DestinationUnixTLSConfig struct {
+	// CertFile is the path to the server certificate.
+	CertFile string `yaml:"cert_file"`
+	// KeyFile is the path to the server certificate's private key.
+	KeyFile string `yaml:"key_file"`
+	// CAFile, if set, is used to require and verify client certificates.
+	CAFile string `yaml:"ca_file,omitempty"`
+}
+
+// DestinationUnix streams renewed certificates and identity files to
+// subscribers connected over a Unix domain socket, rather than persisting
+// them to the filesystem. This is useful for sidecars in the same
+// pod/namespace that want to consume credentials without polling files.
+type DestinationUnix struct {
+	// Path is the filesystem path of the listening socket.
+	Path string `yaml:"path"`
+	// Mode is the Unix file mode applied to the socket, e.g. "0600".
+	Mode string `yaml:"mode,omitempty"`
+	// Owner is the "user" or "user:group" that should own the socket. If
+	// group is omitted, the user's primary group is used.
+	Owner string `yaml:"owner,omitempty"`
+	// SeqPacket selects SOCK_SEQPACKET framing instead of the default
+	// SOCK_STREAM.
+	SeqPacket bool `yaml:"seqpacket,omitempty"`
+	// TLS optionally wraps each accepted connection in TLS.
+	TLS *DestinationUnixTLSConfig `yaml:"tls,omitempty"`
+
+	mode     os.FileMode
+	listener net.Listener
+
+	mu         sync.Mutex
+	pending    map[string][]byte
+	subs       map[net.Conn]struct{}
+	lastBundle []byte
+}
+
+func (du *DestinationUnix) CheckAndSetDefaults() error {
+	if du.Path == "" {
+		return trace.BadParameter("destination unix path must not be empty")
+	}
+
+	if du.Mode == "" {
+		du.mode = 0600
+	} else {
+		mode, err := strconv.ParseUint(du.Mode, 8, 32)
+		if err != nil {
+			return trace.BadParameter("invalid destination unix mode %q: %v", du.Mode, err)
+		}
+		du.mode = os.FileMode(mode)
+	}
+
+	if du.TLS != nil {
+		if du.TLS.CertFile == "" || du.TLS.KeyFile == "" {
+			return trace.BadParameter("destination unix tls block requires cert_file and key_file")
+		}
+		if du.SeqPacket {
+			return trace.BadParameter("destination unix tls and seqpacket cannot be combined: TLS does not preserve datagram boundaries")
+		}
+	}
+
+	return nil
+}
+
+// network returns the socket type to listen/dial with.
+func (du *DestinationUnix) network() string {
+	if du.SeqPacket {
+		return "unixpacket"
+	}
+	return "unix"
+}
+
+// Init creates the listening socket and starts accepting subscribers.
+func (du *DestinationUnix) Init() error {
+	if err := os.RemoveAll(du.Path); err != nil {
+		return trace.Wrap(err)
+	}
+
+	ln, err := net.Listen(du.network(), du.Path)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := os.Chmod(du.Path, du.mode); err != nil {
+		ln.Close()
+		return trace.Wrap(err)
+	}
+
+	if du.Owner != "" {
+		if err := chownPath(du.Path, du.Owner); err != nil {
+			ln.Close()
+			return trace.Wrap(err)
+		}
+	}
+
+	if du.TLS != nil {
+		cert, err := tls.LoadX509KeyPair(du.TLS.CertFile, du.TLS.KeyFile)
+		if err != nil {
+			ln.Close()
+			return trace.Wrap(err)
+		}
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+		if du.TLS.CAFile != "" {
+			caPEM, err := os.ReadFile(du.TLS.CAFile)
+			if err != nil {
+				ln.Close()
+				return trace.Wrap(err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caPEM) {
+				ln.Close()
+				return trace.BadParameter("no certificates found in destination unix tls ca_file %q", du.TLS.CAFile)
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	du.listener = ln
+	du.pending = make(map[string][]byte)
+	du.subs = make(map[net.Conn]struct{})
+
+	go du.acceptLoop()
+
+	return nil
+}
+
+// chownPath resolves owner as a "user" or "user:group" spec and applies it
+// to path. If group is omitted, the user's primary group is used.
+func chownPath(path, owner string) error {
+	userName, groupName, hasGroup := strings.Cut(owner, ":")
+
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return trace.Wrap(err, "looking up owner user %q", userName)
+	}
+
+	gid := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return trace.Wrap(err, "looking up owner group %q", groupName)
+		}
+		gid = g.Gid
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return trace.Wrap(err, "parsing owner uid %q", u.Uid)
+	}
+	gidNum, err := strconv.Atoi(gid)
+	if err != nil {
+		return trace.Wrap(err, "parsing owner gid %q", gid)
+	}
+
+	return trace.Wrap(os.Chown(path, uid, gidNum))
+}
+
+// acceptLoop registers each new subscriber and, if a bundle has already
+// been broadcast since Init, immediately replays the last one so a
+// subscriber that connects between renewals isn't left waiting for the
+// next one.
+func (du *DestinationUnix) acceptLoop() {
+	for {
+		conn, err := du.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		du.mu.Lock()
+		du.subs[conn] = struct{}{}
+		last := du.lastBundle
+		du.mu.Unlock()
+
+		if last == nil {
+			continue
+		}
+		if _, err := conn.Write(last); err != nil {
+			du.mu.Lock()
+			conn.Close()
+			delete(du.subs, conn)
+			du.mu.Unlock()
+		}
+	}
+}
+
+func (du *DestinationUnix) Verify() error {
+	if du.listener == nil {
+		return trace.BadParameter("destination unix socket %s is not initialized", du.Path)
+	}
+	return nil
+}
+
+// Write buffers a named artifact until a full identity bundle has been
+// written, then broadcasts it to all connected subscribers, caching it so
+// that subscribers who connect later get the most recent bundle immediately
+// (see acceptLoop). The artifact names are defined once, as
+// client.ArtifactCert/ArtifactKey/ArtifactCACert/ArtifactIdentity, and must
+// be kept in sync with whatever writes them during renewal.
+func (du *DestinationUnix) Write(name string, data []byte) error {
+	du.mu.Lock()
+	defer du.mu.Unlock()
+
+	du.pending[name] = data
+
+	// ArtifactIdentity is written last in a renewal cycle, so use it as the
+	// signal that a full bundle is available to broadcast.
+	if name != client.ArtifactIdentity {
+		return nil
+	}
+
+	ident := client.Identity{
+		Cert: du.pending[client.ArtifactCert],
+		Key:  du.pending[client.ArtifactKey],
+	}
+	if ca, ok := du.pending[client.ArtifactCACert]; ok {
+		ident.CACerts = [][]byte{ca}
+	}
+	du.pending = make(map[string][]byte)
+
+	payload, err := json.Marshal(ident)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	du.lastBundle = du.frame(payload)
+
+	for conn := range du.subs {
+		if _, err := conn.Write(du.lastBundle); err != nil {
+			conn.Close()
+			delete(du.subs, conn)
+		}
+	}
+
+	return nil
+}
+
+// frame prepares payload for transmission to a subscriber. On a
+// SOCK_SEQPACKET socket each Write is already delivered as one datagram, so
+// payload is sent as-is; a length prefix would just be read back by
+// client.Next as 4 bytes stolen from that same datagram. On a stream
+// socket, writes can be split or coalesced by the kernel, so payload is
+// length-prefixed for client.Next to reassemble.
+func (du *DestinationUnix) frame(payload []byte) []byte {
+	if du.network() == "unixpacket" {
+		return payload
+	}
+
+	framed := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(framed, uint32(len(payload)))
+	copy(framed[4:], payload)
+	return framed
+}
+
+// Read is not supported for DestinationUnix: it is a write-only, streaming
+// destination with no backing store to read artifacts back from.
+func (du *DestinationUnix) Read(name string) ([]byte, error) {
+	return nil, trace.NotImplemented("reading from a unix destination is not supported")
+}
+
+func (du *DestinationUnix) String() string {
+	return fmt.Sprintf("unix socket %s", du.Path)
+}
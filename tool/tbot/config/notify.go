@@ -0,0 +1,160 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/tbot/notify"
+)
+
+// NotifierConfig configures a single destination that gets notified of
+// renewal events. Exactly one of Webhook, SMTP, or File must be set.
+type NotifierConfig struct {
+	Webhook *WebhookNotifierConfig `yaml:"webhook,omitempty"`
+	SMTP    *SMTPNotifierConfig    `yaml:"smtp,omitempty"`
+	File    *FileNotifierConfig    `yaml:"file,omitempty"`
+
+	// On restricts which event types are sent to this notifier. If empty,
+	// all event types are sent.
+	On []string `yaml:"on,omitempty"`
+
+	// MinInterval suppresses repeated events of the same type that occur
+	// within this interval of each other, to avoid flooding the notifier.
+	MinInterval time.Duration `yaml:"min_interval,omitempty"`
+}
+
+// CheckAndSetDefaults validates the notifier config, including whichever
+// sub-config (webhook/smtp/file) is configured.
+func (nc *NotifierConfig) CheckAndSetDefaults() error {
+	count := 0
+	if nc.Webhook != nil {
+		count++
+	}
+	if nc.SMTP != nil {
+		count++
+	}
+	if nc.File != nil {
+		count++
+	}
+	if count != 1 {
+		return trace.BadParameter("exactly one of webhook, smtp, or file must be configured per notifier")
+	}
+
+	for _, t := range nc.On {
+		switch notify.EventType(t) {
+		case notify.EventFailure, notify.EventRecovery, notify.EventExpiryWarning:
+		default:
+			return trace.BadParameter("unknown notifier event type %q", t)
+		}
+	}
+
+	switch {
+	case nc.Webhook != nil:
+		return trace.Wrap(nc.Webhook.CheckAndSetDefaults())
+	case nc.SMTP != nil:
+		return trace.Wrap(nc.SMTP.CheckAndSetDefaults())
+	default:
+		return trace.Wrap(nc.File.CheckAndSetDefaults())
+	}
+}
+
+// EventTypes returns the notify.EventType filter configured by On.
+func (nc *NotifierConfig) EventTypes() []notify.EventType {
+	types := make([]notify.EventType, 0, len(nc.On))
+	for _, t := range nc.On {
+		types = append(types, notify.EventType(t))
+	}
+	return types
+}
+
+// GetNotifier returns the notify.Notifier implied by whichever sub-config
+// is set.
+func (nc *NotifierConfig) GetNotifier() (notify.Notifier, error) {
+	switch {
+	case nc.Webhook != nil:
+		return &notify.Webhook{URL: nc.Webhook.URL}, nil
+	case nc.SMTP != nil:
+		return &notify.SMTP{Addr: nc.SMTP.Addr, From: nc.SMTP.From, To: nc.SMTP.To}, nil
+	case nc.File != nil:
+		return &notify.File{Path: nc.File.Path}, nil
+	default:
+		return nil, trace.BadParameter("no notifier configured")
+	}
+}
+
+// WebhookNotifierConfig configures a notifier that POSTs JSON events to a
+// URL.
+type WebhookNotifierConfig struct {
+	URL string `yaml:"url"`
+}
+
+func (c *WebhookNotifierConfig) CheckAndSetDefaults() error {
+	if c.URL == "" {
+		return trace.BadParameter("webhook notifier requires a url")
+	}
+
+	parsed, err := url.Parse(c.URL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return trace.BadParameter("webhook notifier url %q is not a valid absolute URL", c.URL)
+	}
+
+	return nil
+}
+
+// SMTPNotifierConfig configures a notifier that emails a summary of the
+// event.
+type SMTPNotifierConfig struct {
+	Addr string   `yaml:"addr"`
+	From string   `yaml:"from"`
+	To   []string `yaml:"to"`
+}
+
+func (c *SMTPNotifierConfig) CheckAndSetDefaults() error {
+	if c.Addr == "" {
+		return trace.BadParameter("smtp notifier requires an addr")
+	}
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		return trace.BadParameter("smtp notifier addr %q must be host:port: %v", c.Addr, err)
+	}
+	if c.From == "" {
+		return trace.BadParameter("smtp notifier requires a from address")
+	}
+	if len(c.To) == 0 {
+		return trace.BadParameter("smtp notifier requires at least one to address")
+	}
+
+	return nil
+}
+
+// FileNotifierConfig configures a notifier that appends JSONL records of
+// each event to a local file.
+type FileNotifierConfig struct {
+	Path string `yaml:"path"`
+}
+
+func (c *FileNotifierConfig) CheckAndSetDefaults() error {
+	if c.Path == "" {
+		return trace.BadParameter("file notifier requires a path")
+	}
+
+	return nil
+}
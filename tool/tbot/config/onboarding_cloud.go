@@ -0,0 +1,225 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/lib/tbot/client"
+)
+
+const (
+	// DefaultExecutableTimeout bounds how long the `executable` join method
+	// will wait for its configured command to produce a token.
+	DefaultExecutableTimeout = 30 * time.Second
+
+	gcpMetadataIdentityURL   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+	azureMetadataIdentityURL = "http://169.254.169.254/metadata/attested/document"
+)
+
+// CredentialSource produces a subject token that proves a workload's
+// identity to a cloud provider, for use with a matching cloud join method.
+// The auth server verifies the token server-side before issuing certs.
+type CredentialSource interface {
+	// GetSubjectToken returns a signed token or attestation document that
+	// the auth server can verify to establish the bot's identity.
+	GetSubjectToken(ctx context.Context) (string, error)
+}
+
+// RegistrationClient is the minimal auth client surface a cloud join method
+// needs: exchanging a subject token, plus the join method name it proves,
+// for bot certificates. It mirrors auth.RegisterUsingToken, which does not
+// exist in this tree; the real auth client should satisfy it directly once
+// this package is vendored alongside lib/auth. Per-provider verification of
+// the subject token (checking a GCP/Azure signature against the cloud
+// provider, etc.) is server-side work that belongs with that client and is
+// not implemented here.
+type RegistrationClient interface {
+	RegisterUsingToken(ctx context.Context, joinMethod types.JoinMethod, subjectToken string) (*client.Identity, error)
+}
+
+// Register completes a cloud join method by fetching a subject token from
+// source and exchanging it with authClient for a bot identity. This is the
+// call site that makes CredentialSource.GetSubjectToken reachable; without
+// it the interface would be implemented but never invoked.
+func Register(ctx context.Context, authClient RegistrationClient, joinMethod types.JoinMethod, source CredentialSource) (*client.Identity, error) {
+	token, err := source.GetSubjectToken(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	identity, err := authClient.RegisterUsingToken(ctx, joinMethod, token)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return identity, nil
+}
+
+// GCPOnboardingConfig configures the `gcp` join method, which fetches a
+// signed identity token from the GCP instance metadata service.
+type GCPOnboardingConfig struct {
+	// Audience is the `aud` claim requested for the identity token,
+	// typically of the form "//iam.googleapis.com/...".
+	Audience string `yaml:"audience"`
+
+	// ServiceAccountEmail, if set, impersonates the given service account
+	// when requesting the identity token rather than using the instance's
+	// default service account.
+	ServiceAccountEmail string `yaml:"service_account_email,omitempty"`
+}
+
+func (c *GCPOnboardingConfig) CheckAndSetDefaults() error {
+	if c.Audience == "" {
+		return trace.BadParameter("gcp onboarding config requires an audience")
+	}
+	return nil
+}
+
+// GetSubjectToken fetches a signed identity token from the GCP instance
+// metadata server.
+func (c *GCPOnboardingConfig) GetSubjectToken(ctx context.Context) (string, error) {
+	identityURL := gcpMetadataIdentityURL
+	if c.ServiceAccountEmail != "" {
+		identityURL = fmt.Sprintf(
+			"http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/%s/identity",
+			url.PathEscape(c.ServiceAccountEmail),
+		)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, identityURL, nil)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	q := req.URL.Query()
+	q.Set("audience", c.Audience)
+	q.Set("format", "full")
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", trace.BadParameter("gcp metadata server returned %d: %s", resp.StatusCode, body)
+	}
+
+	return string(body), nil
+}
+
+// AzureOnboardingConfig configures the `azure` join method, which fetches a
+// signed attested data document from the Azure instance metadata service.
+type AzureOnboardingConfig struct {
+	// Nonce is passed as the IMDS attested-document "nonce" query parameter,
+	// letting the auth server bind a fetched token to a particular join
+	// attempt rather than accepting a replayed document.
+	Nonce string `yaml:"nonce,omitempty"`
+}
+
+func (c *AzureOnboardingConfig) CheckAndSetDefaults() error {
+	return nil
+}
+
+// GetSubjectToken fetches the signed attested data document from the Azure
+// instance metadata server.
+func (c *AzureOnboardingConfig) GetSubjectToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureMetadataIdentityURL, nil)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	req.Header.Set("Metadata", "true")
+	q := req.URL.Query()
+	q.Set("api-version", "2021-02-01")
+	if c.Nonce != "" {
+		q.Set("nonce", c.Nonce)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", trace.BadParameter("azure metadata server returned %d: %s", resp.StatusCode, body)
+	}
+
+	return string(body), nil
+}
+
+// ExecutableOnboardingConfig configures the `executable` join method, which
+// runs a configured command and uses its stdout as the subject token. This
+// is gated behind OnboardingConfig.AllowExecutable, since it allows a
+// config file to drive arbitrary code execution.
+type ExecutableOnboardingConfig struct {
+	// Command is the command (and arguments) to execute.
+	Command []string `yaml:"command"`
+
+	// Timeout bounds how long the command is allowed to run.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+func (c *ExecutableOnboardingConfig) CheckAndSetDefaults() error {
+	if len(c.Command) == 0 {
+		return trace.BadParameter("executable onboarding config requires a command")
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = DefaultExecutableTimeout
+	}
+
+	return nil
+}
+
+// GetSubjectToken runs the configured command and returns its trimmed
+// stdout as the subject token.
+func (c *ExecutableOnboardingConfig) GetSubjectToken(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return "", trace.Wrap(err, "running executable credential source")
+	}
+
+	return string(bytes.TrimSpace(stdout.Bytes())), nil
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/gravitational/trace"
+)
+
+// DefaultRemoteConfigPollInterval is how often the bot re-fetches its
+// BotInstanceConfig resource when remote_config is enabled.
+const DefaultRemoteConfigPollInterval = 5 * time.Minute
+
+// RemoteConfig lets a fleet of bots be configured centrally from the auth
+// server, rather than by editing YAML on each host.
+type RemoteConfig struct {
+	// Enabled turns on remote configuration.
+	Enabled bool `yaml:"enabled"`
+
+	// PollInterval is how often to re-fetch the remote resource.
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+
+	// ResourceName is the name of the BotInstanceConfig resource to fetch.
+	ResourceName string `yaml:"resource_name"`
+}
+
+// CheckAndSetDefaults validates the remote config and fills in defaults.
+func (rc *RemoteConfig) CheckAndSetDefaults() error {
+	if !rc.Enabled {
+		return nil
+	}
+
+	if rc.ResourceName == "" {
+		return trace.BadParameter("remote_config requires a resource_name when enabled")
+	}
+
+	if rc.PollInterval < 0 {
+		return trace.BadParameter("remote_config poll_interval must not be negative")
+	}
+	if rc.PollInterval == 0 {
+		rc.PollInterval = DefaultRemoteConfigPollInterval
+	}
+
+	return nil
+}
+
+// BotInstanceConfig is the subset of a bot's centrally-managed
+// configuration that can be hydrated from the auth server. It mirrors the
+// shape of the types.BotInstanceConfig resource; callers obtain one via a
+// RemoteConfigClient.
+type BotInstanceConfig struct {
+	// ResourceName is the name this resource was fetched as.
+	ResourceName string
+	// Destinations are additional destinations to merge into the bot's
+	// local configuration.
+	Destinations []*DestinationConfig
+}
+
+// RemoteConfigClient is the minimal auth client surface RemoteConfig needs
+// in order to fetch its BotInstanceConfig resource.
+type RemoteConfigClient interface {
+	// GetBotInstanceConfig fetches the named BotInstanceConfig resource.
+	GetBotInstanceConfig(ctx context.Context, resourceName string) (*BotInstanceConfig, error)
+}
+
+// EffectiveDestinations returns conf.Destinations merged with any
+// destinations fetched from the auth server via remote_config. Local
+// destinations always win on path collision.
+func (conf *BotConfig) EffectiveDestinations() []*DestinationConfig {
+	conf.remoteMu.RLock()
+	remote := conf.remoteDestinations
+	conf.remoteMu.RUnlock()
+
+	if len(remote) == 0 {
+		return conf.Destinations
+	}
+
+	localPaths := make(map[string]bool, len(conf.Destinations))
+	for _, dest := range conf.Destinations {
+		if path, ok := destinationPath(dest); ok {
+			localPaths[path] = true
+		}
+	}
+
+	merged := make([]*DestinationConfig, len(conf.Destinations), len(conf.Destinations)+len(remote))
+	copy(merged, conf.Destinations)
+
+	for _, dest := range remote {
+		path, ok := destinationPath(dest)
+		if ok && localPaths[path] {
+			log.Warnf("remote destination %s conflicts with a local destination and was ignored", path)
+			continue
+		}
+		merged = append(merged, dest)
+	}
+
+	return merged
+}
+
+// StartRemoteConfigWatcher fetches the configured BotInstanceConfig
+// resource and begins polling for updates on RemoteConfig.PollInterval,
+// reconciling added and removed destinations as they change. It returns a
+// stop function, or (nil, nil) if remote_config is not enabled.
+func (conf *BotConfig) StartRemoteConfigWatcher(ctx context.Context, client RemoteConfigClient) (func(), error) {
+	if conf.RemoteConfig == nil || !conf.RemoteConfig.Enabled {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Remote config is additive to the bot's local destinations, so a
+	// failure to fetch it (e.g. a transient auth server outage) should not
+	// prevent the bot from starting up on its local configuration alone.
+	if err := conf.refreshRemoteDestinations(ctx, client); err != nil {
+		log.Warnf("failed to fetch initial remote config: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(conf.RemoteConfig.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := conf.refreshRemoteDestinations(ctx, client); err != nil {
+					log.Warnf("failed to refresh remote config: %v", err)
+				}
+			}
+		}
+	}()
+
+	return cancel, nil
+}
+
+// refreshRemoteDestinations fetches the latest BotInstanceConfig and
+// reconciles any added or removed destinations against the previous fetch.
+func (conf *BotConfig) refreshRemoteDestinations(ctx context.Context, client RemoteConfigClient) error {
+	instance, err := client.GetBotInstanceConfig(ctx, conf.RemoteConfig.ResourceName)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	// Validate before storing: an invalid destination must never be kept
+	// in conf.remoteDestinations, or EffectiveDestinations() would surface
+	// it to the renewal loop despite never having been Init'd.
+	valid := make([]*DestinationConfig, 0, len(instance.Destinations))
+	for _, dest := range instance.Destinations {
+		if err := dest.CheckAndSetDefaults(); err != nil {
+			log.Warnf("skipping invalid remote destination: %v", err)
+			continue
+		}
+		valid = append(valid, dest)
+	}
+
+	conf.remoteMu.Lock()
+	previous := conf.remoteDestinations
+	conf.remoteDestinations = valid
+	conf.remoteMu.Unlock()
+
+	added, removed := diffDestinations(previous, valid)
+	for _, dest := range added {
+		destImpl, err := dest.GetDestination()
+		if err != nil {
+			log.Warnf("skipping invalid remote destination: %v", err)
+			continue
+		}
+		if err := destImpl.Init(); err != nil {
+			log.Warnf("failed to initialize remote destination %s: %v", destImpl, err)
+			continue
+		}
+		if err := destImpl.Verify(); err != nil {
+			log.Warnf("failed to verify remote destination %s: %v", destImpl, err)
+		}
+	}
+
+	for _, dest := range removed {
+		if path, ok := destinationPath(dest); ok {
+			log.Infof("remote destination %s was removed upstream and will no longer be renewed", path)
+		}
+	}
+
+	return nil
+}
+
+// diffDestinations compares two destination lists by path, returning the
+// destinations present in next but not prev ("added") and vice versa
+// ("removed"). Destinations with no path (e.g. unconfigured) cannot be
+// matched, so those in next are always reported as added and those in prev
+// are never reported as removed.
+func diffDestinations(prev, next []*DestinationConfig) (added, removed []*DestinationConfig) {
+	prevPaths := make(map[string]bool, len(prev))
+	for _, dest := range prev {
+		if path, ok := destinationPath(dest); ok {
+			prevPaths[path] = true
+		}
+	}
+
+	nextPaths := make(map[string]bool, len(next))
+	for _, dest := range next {
+		path, ok := destinationPath(dest)
+		if ok {
+			nextPaths[path] = true
+		}
+		if !ok || !prevPaths[path] {
+			added = append(added, dest)
+		}
+	}
+
+	for _, dest := range prev {
+		path, ok := destinationPath(dest)
+		if ok && !nextPaths[path] {
+			removed = append(removed, dest)
+		}
+	}
+
+	return added, removed
+}
+
+// destinationPath returns the filesystem or socket path of dest, if it has
+// one.
+func destinationPath(dest *DestinationConfig) (string, bool) {
+	destImpl, err := dest.GetDestination()
+	if err != nil {
+		return "", false
+	}
+
+	switch d := destImpl.(type) {
+	case *DestinationDirectory:
+		return d.Path, true
+	case *DestinationUnix:
+		return d.Path, true
+	default:
+		return "", false
+	}
+}